@@ -0,0 +1,68 @@
+package layer2
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/go-logr/logr"
+	"golang.org/x/time/rate"
+)
+
+// Backend selects which implementation NewAnnouncer constructs.
+type Backend string
+
+const (
+	// BackendRaw uses mdlayher/raw + mdlayher/arp AF_PACKET sockets.
+	// This is the default and matches porter's historical behavior.
+	BackendRaw Backend = "raw"
+	// BackendPcap uses github.com/google/gopacket/pcap with a BPF
+	// filter, for platforms/kernels where AF_PACKET raw sockets are
+	// restricted, or when capturing on bridged/VLAN sub-interfaces.
+	BackendPcap Backend = "pcap"
+)
+
+// Config selects and parameterizes an Announcer backend.
+type Config struct {
+	Backend   Backend
+	Interface *net.Interface
+	Logger    logr.Logger
+
+	// ReplyRate and ReplyBurst configure the per-sender ARP reply
+	// limiter. ReplyRate is in replies/sec; zero means unlimited.
+	ReplyRate  rate.Limit
+	ReplyBurst int
+}
+
+// Announcer is the common surface arpResponder, ndpResponder and
+// pcapAnnouncer implement. Callers should always go through this
+// interface rather than type-asserting back to a concrete backend, so
+// NewAnnouncer's choice of backend stays transparent to them.
+type Announcer interface {
+	// Gratuitous announces ip as reachable via nodeIP, registering it so
+	// that subsequent solicitations for ip are answered.
+	Gratuitous(ip, nodeIP net.IP) error
+	// DeleteIP forgets a previously announced IP.
+	DeleteIP(ip string)
+	// Conflicts returns the channel on which PeerConflict events are
+	// delivered when a peer is observed claiming an announced IP with a
+	// different MAC.
+	Conflicts() <-chan PeerConflict
+	// SetReannounceInterval configures periodic re-announcement of every
+	// announced IP. An interval of zero disables it.
+	SetReannounceInterval(d time.Duration)
+	Close() error
+}
+
+// NewAnnouncer constructs the Announcer backend selected by cfg.Backend,
+// defaulting to BackendRaw when unset.
+func NewAnnouncer(cfg Config) (Announcer, error) {
+	switch cfg.Backend {
+	case "", BackendRaw:
+		return newARPResponder(cfg.Logger, cfg.Interface, cfg.ReplyRate, cfg.ReplyBurst)
+	case BackendPcap:
+		return newPcapAnnouncer(cfg.Logger, cfg.Interface, cfg.ReplyRate, cfg.ReplyBurst)
+	default:
+		return nil, fmt.Errorf("unknown layer2 announcer backend %q", cfg.Backend)
+	}
+}
@@ -8,8 +8,11 @@ import (
 	"github.com/mdlayher/ethernet"
 	"github.com/mdlayher/raw"
 	"github.com/vishvananda/netlink"
+	"golang.org/x/time/rate"
 	"io"
 	"net"
+	"sync"
+	"time"
 )
 
 const protocolARP = 0x0806
@@ -22,10 +25,112 @@ type arpResponder struct {
 	p      *raw.Conn
 	closed chan struct{}
 
-	ip2mac map[string]*net.HardwareAddr
+	// registry holds the IPs we're announcing and their MACs, shared
+	// with ndpResponder and pcapAnnouncer.
+	registry *ipRegistry
+
+	// peers is a rolling, TTL-bounded record of the last MAC address
+	// observed claiming each IP on the wire, via either an ARP reply or
+	// an ARP announcement (request with SenderIP == TargetIP).
+	peers *peerTracker
+	// conflicts receives a PeerConflict whenever a peer is observed
+	// claiming an IP that we are actively announcing with a different
+	// MAC. It is buffered and non-blocking: a caller that doesn't drain
+	// it will only miss conflict notifications, never stall the
+	// responder.
+	conflicts chan PeerConflict
+
+	// limiter throttles replies per (TargetIP, SenderHardwareAddr), so
+	// that an ARP storm or a scanner sweeping the subnet can't flood the
+	// wire or the log pipeline. A nil or zero-rate limiter never
+	// throttles.
+	limiter *replyLimiter
+
+	reannounce *reannouncer
+}
+
+const (
+	// replyLimiterTTL is how long a per-sender bucket can go unused
+	// before it's eligible for eviction. An ARP scanner that spoofs a
+	// new source MAC per packet would otherwise grow buckets without
+	// bound.
+	replyLimiterTTL = 5 * time.Minute
+	// replyLimiterSweepEvery sweeps expired buckets every this many
+	// calls to Allow, so the sweep cost is amortized across traffic
+	// instead of requiring its own goroutine.
+	replyLimiterSweepEvery = 1024
+)
+
+// replyLimiter is a set of per-sender token buckets, keyed by the
+// (target IP, sender MAC) pair. Buckets unused for longer than
+// replyLimiterTTL are swept away.
+type replyLimiter struct {
+	rate  rate.Limit
+	burst int
+
+	mu      sync.Mutex
+	buckets map[string]*replyBucket
+	calls   uint64
+}
+
+type replyBucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newReplyLimiter(r rate.Limit, burst int) *replyLimiter {
+	return &replyLimiter{rate: r, burst: burst, buckets: make(map[string]*replyBucket)}
+}
+
+// Allow reports whether a reply to sender asking about ip should be sent
+// now. A nil limiter, or one configured with a non-positive rate, never
+// throttles.
+func (l *replyLimiter) Allow(ip net.IP, sender net.HardwareAddr) bool {
+	if l == nil || l.rate <= 0 {
+		return true
+	}
+
+	key := ip.String() + "|" + sender.String()
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.calls++
+	if l.calls%replyLimiterSweepEvery == 0 {
+		l.sweepLocked(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &replyBucket{limiter: rate.NewLimiter(l.rate, l.burst)}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+	return b.limiter.Allow()
 }
 
-func newARPResponder(log logr.Logger, ifi *net.Interface) (*arpResponder, error) {
+// sweepLocked removes buckets that haven't been used in replyLimiterTTL.
+// l.mu must be held.
+func (l *replyLimiter) sweepLocked(now time.Time) {
+	for key, b := range l.buckets {
+		if now.Sub(b.lastSeen) > replyLimiterTTL {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// PeerConflict describes a peer on the LAN claiming an IP that we are
+// currently announcing in the registry, using a MAC address other than ours.
+// Callers can consume this to withdraw the announcement or trigger a
+// defensive gratuitous re-announce.
+type PeerConflict struct {
+	IP      net.IP
+	OurMAC  net.HardwareAddr
+	PeerMAC net.HardwareAddr
+}
+
+func newARPResponder(log logr.Logger, ifi *net.Interface, replyRate rate.Limit, replyBurst int) (*arpResponder, error) {
 	p, err := raw.ListenPacket(ifi, protocolARP, nil)
 	if err != nil {
 		return nil, err
@@ -36,17 +141,87 @@ func newARPResponder(log logr.Logger, ifi *net.Interface) (*arpResponder, error)
 	}
 
 	ret := &arpResponder{
-		logger: log.WithName("arpResponder"),
-		intf:   ifi,
-		conn:   client,
-		p:      p,
-		closed: make(chan struct{}),
-		ip2mac: make(map[string]*net.HardwareAddr),
+		logger:    log.WithName("arpResponder"),
+		intf:      ifi,
+		conn:      client,
+		p:         p,
+		closed:    make(chan struct{}),
+		registry:  newIPRegistry(),
+		peers:     newPeerTracker(),
+		conflicts: make(chan PeerConflict, 16),
+		limiter:   newReplyLimiter(replyRate, replyBurst),
 	}
+	ret.reannounce = newReannouncer(ret.closed, ret.sendGratuitousPacket, ret.registry.ips)
 	go ret.run()
 	return ret, nil
 }
 
+// SetReannounceInterval configures a periodic re-send of the gratuitous
+// request+reply pair for every announced IP, with jitter so that many
+// nodes re-announcing on the same interval don't all hit the wire at
+// once. An interval of zero disables periodic re-announcement.
+func (a *arpResponder) SetReannounceInterval(d time.Duration) {
+	a.reannounce.SetInterval(d)
+}
+
+// sendGratuitousPacket re-sends the gratuitous request+reply pair for an
+// already-announced ip, using whatever MAC is currently registered for
+// it. It is used both for the initial post-announce burst and for
+// periodic re-announcement.
+func (a *arpResponder) sendGratuitousPacket(ip net.IP) {
+	hwAddr := a.registry.lookup(ip.String())
+	if hwAddr == nil {
+		return
+	}
+
+	for _, op := range []arp.Operation{arp.OperationRequest, arp.OperationReply} {
+		fb, err := generateArp(a.intf.HardwareAddr, op, *hwAddr, ip, ethernet.Broadcast, ip)
+		if err != nil {
+			a.logger.Error(err, "generating re-announce arp packet", "eip", ip)
+			return
+		}
+		if _, err := a.p.WriteTo(fb, &raw.Addr{HardwareAddr: ethernet.Broadcast}); err != nil {
+			a.logger.Error(err, "send re-announce arp packet", "eip", ip)
+			return
+		}
+	}
+}
+
+// Conflicts returns the channel on which PeerConflicts are delivered.
+func (a *arpResponder) Conflicts() <-chan PeerConflict {
+	return a.conflicts
+}
+
+// observePeer records that peerMAC claims ip on the wire, and reports a
+// PeerConflict if we are actively announcing ip with a different MAC.
+func (a *arpResponder) observePeer(ip net.IP, peerMAC net.HardwareAddr) {
+	ourMAC := a.registry.lookup(ip.String())
+
+	conflict := a.peers.observe(ip, peerMAC, ourMAC)
+	if conflict == nil {
+		return
+	}
+
+	a.logger.Info("peer claims announced IP with a different MAC", "ip", ip, "ourMAC", conflict.OurMAC, "peerMAC", conflict.PeerMAC)
+	select {
+	case a.conflicts <- *conflict:
+	default:
+		a.logger.Info("conflicts channel full, dropping peer conflict event", "ip", ip)
+	}
+}
+
+func bytesEqualHW(a, b net.HardwareAddr) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
 func (a *arpResponder) Close() error {
 	close(a.closed)
 	return a.conn.Close()
@@ -80,7 +255,12 @@ func generateArp(intfHW net.HardwareAddr, op arp.Operation, srcHW net.HardwareAd
 }
 
 func (a *arpResponder) DeleteIP(ip string) {
-	delete(a.ip2mac, ip)
+	a.registry.delete(ip)
+	a.peers.forget(ip)
+	forgetAnnounce(ip)
+	if parsed := net.ParseIP(ip); parsed != nil {
+		a.reannounce.forgetAnnounced(parsed)
+	}
 }
 
 func resolveIP(nodeIP net.IP, iface *net.Interface) (hwAddr net.HardwareAddr, err error) {
@@ -130,7 +310,9 @@ func (a *arpResponder) Gratuitous(ip, nodeIP net.IP) error {
 		}
 	}
 
-	a.ip2mac[ip.String()] = &hwAddr
+	a.registry.set(ip.String(), hwAddr)
+	recordAnnounce(ip)
+	a.reannounce.noteAnnounced(ip)
 
 	for _, op := range []arp.Operation{arp.OperationRequest, arp.OperationReply} {
 		a.logger.Info("send gratuitous arp packet", "eip", ip, "nodeIP", nodeIP, "hwAddr", hwAddr)
@@ -168,25 +350,50 @@ func (a *arpResponder) processRequest() dropReason {
 		if err == io.EOF {
 			return dropReasonClosed
 		}
+		recordDrop(dropReasonError)
 		return dropReasonError
 	}
 
-	// Ignore ARP replies.
+	// ARP replies don't ask us for anything, but a peer replying to a
+	// query for one of our announced IPs may be a sign of cache
+	// poisoning, so observe it before dropping.
 	if pkt.Operation != arp.OperationRequest {
+		a.observePeer(pkt.SenderIP, pkt.SenderHardwareAddr)
+		recordDrop(dropReasonARPReply)
 		return dropReasonARPReply
 	}
 
-	hwAddr := a.ip2mac[pkt.TargetIP.String()]
+	arpRequestsReceived.Inc()
+
+	// An ARP announcement (SenderIP == TargetIP) is a peer telling the
+	// LAN "this IP is mine" unprompted; track it the same way.
+	if pkt.SenderIP.Equal(pkt.TargetIP) {
+		a.observePeer(pkt.SenderIP, pkt.SenderHardwareAddr)
+	}
+
+	hwAddr := a.registry.lookup(pkt.TargetIP.String())
 	if hwAddr == nil {
+		recordDrop(dropReasonAnnounceIP)
 		return dropReasonAnnounceIP
 	}
+
+	if !a.limiter.Allow(pkt.TargetIP, pkt.SenderHardwareAddr) {
+		arpRepliesThrottled.Inc()
+		recordDrop(dropReasonThrottled)
+		return dropReasonThrottled
+	}
+
 	a.logger.Info("got ARP request, sending response", "interface", a.intf.Name, "ip", pkt.TargetIP, "senderIP", pkt.SenderIP, "senderMAC", pkt.SenderHardwareAddr, "responseMAC", hwAddr)
 	fb, err := generateArp(a.intf.HardwareAddr, arp.OperationReply, *hwAddr, pkt.TargetIP, pkt.SenderHardwareAddr, pkt.SenderIP)
 	if err != nil {
+		recordDrop(dropReasonError)
 		return dropReasonError
 	}
 	if _, err := a.p.WriteTo(fb, &raw.Addr{HardwareAddr: pkt.SenderHardwareAddr}); err != nil {
 		a.logger.Error(err, "op", "arpReply", "interface", a.intf.Name, "ip", pkt.TargetIP, "senderIP", pkt.SenderIP, "senderMAC", pkt.SenderHardwareAddr, "responseMAC", hwAddr)
+		recordDrop(dropReasonError)
+		return dropReasonError
 	}
+	arpRepliesSent.Inc()
 	return dropReasonNone
 }
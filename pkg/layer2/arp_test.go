@@ -0,0 +1,41 @@
+package layer2
+
+import (
+	"net"
+	"testing"
+)
+
+func mustParseMAC(t *testing.T, s string) net.HardwareAddr {
+	t.Helper()
+	if s == "" {
+		return nil
+	}
+	mac, err := net.ParseMAC(s)
+	if err != nil {
+		t.Fatalf("parsing MAC %q: %s", s, err)
+	}
+	return mac
+}
+
+func TestBytesEqualHW(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want bool
+	}{
+		{"equal", "00:11:22:33:44:55", "00:11:22:33:44:55", true},
+		{"different", "00:11:22:33:44:55", "00:11:22:33:44:66", false},
+		{"different length", "00:11:22:33:44:55:66:77", "00:11:22:33:44:55", false},
+		{"both empty", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := mustParseMAC(t, tt.a)
+			b := mustParseMAC(t, tt.b)
+			if got := bytesEqualHW(a, b); got != tt.want {
+				t.Errorf("bytesEqualHW(%s, %s) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
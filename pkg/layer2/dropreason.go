@@ -0,0 +1,14 @@
+package layer2
+
+// dropReason records why processRequest declined to answer an incoming
+// request, for logging and for the requests_dropped_total metric.
+type dropReason int
+
+const (
+	dropReasonNone dropReason = iota
+	dropReasonClosed
+	dropReasonError
+	dropReasonARPReply
+	dropReasonAnnounceIP
+	dropReasonThrottled
+)
@@ -0,0 +1,77 @@
+package layer2
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestReplyLimiterAllow(t *testing.T) {
+	ip := net.ParseIP("192.0.2.1")
+	mac := mustParseMAC(t, "00:11:22:33:44:55")
+	otherMAC := mustParseMAC(t, "00:11:22:33:44:66")
+
+	l := newReplyLimiter(rate.Limit(1), 2)
+
+	// Burst of 2 should be allowed immediately...
+	if !l.Allow(ip, mac) {
+		t.Fatalf("first reply unexpectedly throttled")
+	}
+	if !l.Allow(ip, mac) {
+		t.Fatalf("second reply (within burst) unexpectedly throttled")
+	}
+	// ...and the third, immediately after, should not.
+	if l.Allow(ip, mac) {
+		t.Fatalf("third reply should have been throttled")
+	}
+
+	// A different sender asking about the same IP has its own bucket.
+	if !l.Allow(ip, otherMAC) {
+		t.Fatalf("reply for a different sender unexpectedly throttled")
+	}
+}
+
+func TestReplyLimiterNilOrUnlimited(t *testing.T) {
+	ip := net.ParseIP("192.0.2.1")
+	mac := mustParseMAC(t, "00:11:22:33:44:55")
+
+	var nilLimiter *replyLimiter
+	for i := 0; i < 5; i++ {
+		if !nilLimiter.Allow(ip, mac) {
+			t.Fatalf("nil limiter should never throttle")
+		}
+	}
+
+	unlimited := newReplyLimiter(0, 0)
+	for i := 0; i < 5; i++ {
+		if !unlimited.Allow(ip, mac) {
+			t.Fatalf("zero-rate limiter should never throttle")
+		}
+	}
+}
+
+func TestReplyLimiterSweepsStaleBuckets(t *testing.T) {
+	l := newReplyLimiter(rate.Limit(1), 1)
+
+	ip := net.ParseIP("192.0.2.1")
+	mac := mustParseMAC(t, "00:11:22:33:44:55")
+	l.Allow(ip, mac)
+
+	l.mu.Lock()
+	l.buckets[ip.String()+"|"+mac.String()].lastSeen = time.Now().Add(-2 * replyLimiterTTL)
+	l.calls = replyLimiterSweepEvery - 1
+	l.mu.Unlock()
+
+	// This call crosses the sweep threshold. It uses a second, unrelated
+	// key so that it can't recreate the stale bucket it should sweep.
+	otherIP := net.ParseIP("192.0.2.2")
+	l.Allow(otherIP, mac)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.buckets[ip.String()+"|"+mac.String()]; ok {
+		t.Errorf("stale bucket was not swept")
+	}
+}
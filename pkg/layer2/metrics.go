@@ -0,0 +1,82 @@
+package layer2
+
+import (
+	"net"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	arpRequestsReceived = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "porter",
+		Subsystem: "layer2",
+		Name:      "arp_requests_received_total",
+		Help:      "Number of ARP requests received on announced interfaces.",
+	})
+	arpRepliesSent = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "porter",
+		Subsystem: "layer2",
+		Name:      "arp_replies_sent_total",
+		Help:      "Number of ARP replies sent for announced IPs.",
+	})
+	arpRepliesThrottled = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "porter",
+		Subsystem: "layer2",
+		Name:      "arp_replies_throttled_total",
+		Help:      "Number of ARP replies withheld by the per-sender rate limiter.",
+	})
+	dropsByReason = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "porter",
+		Subsystem: "layer2",
+		Name:      "requests_dropped_total",
+		Help:      "Number of incoming requests dropped, by reason.",
+	}, []string{"reason"})
+	lastAnnounce = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "porter",
+		Subsystem: "layer2",
+		Name:      "last_announce_timestamp_seconds",
+		Help:      "Unix timestamp of the last gratuitous announcement for an EIP.",
+	}, []string{"ip"})
+)
+
+// RegisterMetrics registers the layer2 package's collectors with
+// registerer, so the top-level manager can expose them on its existing
+// metrics endpoint rather than the package standing up its own.
+func RegisterMetrics(registerer prometheus.Registerer) {
+	registerer.MustRegister(arpRequestsReceived, arpRepliesSent, arpRepliesThrottled, dropsByReason, lastAnnounce)
+}
+
+// dropReasonLabel maps a dropReason to the metric label used for it.
+func dropReasonLabel(reason dropReason) string {
+	switch reason {
+	case dropReasonNone:
+		return "none"
+	case dropReasonClosed:
+		return "closed"
+	case dropReasonError:
+		return "error"
+	case dropReasonARPReply:
+		return "arp_reply"
+	case dropReasonAnnounceIP:
+		return "not_announced"
+	case dropReasonThrottled:
+		return "throttled"
+	default:
+		return "unknown"
+	}
+}
+
+func recordDrop(reason dropReason) {
+	dropsByReason.WithLabelValues(dropReasonLabel(reason)).Inc()
+}
+
+func recordAnnounce(ip net.IP) {
+	lastAnnounce.WithLabelValues(ip.String()).Set(float64(time.Now().Unix()))
+}
+
+// forgetAnnounce clears the last-announce gauge for ip, so that deleted
+// EIPs don't accumulate as unbounded Prometheus label cardinality.
+func forgetAnnounce(ip string) {
+	lastAnnounce.DeleteLabelValues(ip)
+}
@@ -0,0 +1,43 @@
+package layer2
+
+import (
+	"net"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDropReasonLabel(t *testing.T) {
+	tests := []struct {
+		reason dropReason
+		want   string
+	}{
+		{dropReasonNone, "none"},
+		{dropReasonClosed, "closed"},
+		{dropReasonError, "error"},
+		{dropReasonARPReply, "arp_reply"},
+		{dropReasonAnnounceIP, "not_announced"},
+		{dropReasonThrottled, "throttled"},
+		{dropReason(99), "unknown"},
+	}
+
+	for _, tt := range tests {
+		if got := dropReasonLabel(tt.reason); got != tt.want {
+			t.Errorf("dropReasonLabel(%v) = %q, want %q", tt.reason, got, tt.want)
+		}
+	}
+}
+
+func TestForgetAnnounceClearsGauge(t *testing.T) {
+	ip := net.ParseIP("192.0.2.1")
+
+	recordAnnounce(ip)
+	if got := testutil.ToFloat64(lastAnnounce.WithLabelValues(ip.String())); got == 0 {
+		t.Fatalf("expected lastAnnounce to be set after recordAnnounce")
+	}
+
+	forgetAnnounce(ip.String())
+	if n := testutil.CollectAndCount(lastAnnounce, "porter_layer2_last_announce_timestamp_seconds"); n != 0 {
+		t.Errorf("expected lastAnnounce to have no series after forgetAnnounce, got %d", n)
+	}
+}
@@ -0,0 +1,411 @@
+package layer2
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	icmpTypeNeighborSolicitation  = 135
+	icmpTypeNeighborAdvertisement = 136
+
+	ndpOptSourceLinkLayerAddr = 1
+	ndpOptTargetLinkLayerAddr = 2
+
+	naFlagRouter    = 1 << 31
+	naFlagSolicited = 1 << 30
+	naFlagOverride  = 1 << 29
+)
+
+// ndpResponder is the IPv6 peer of arpResponder: it answers ICMPv6
+// Neighbor Solicitations for announced VIPs and can emit unsolicited
+// Neighbor Advertisements, the IPv6 equivalent of gratuitous ARP.
+type ndpResponder struct {
+	logger logr.Logger
+
+	intf   *net.Interface
+	conn   *icmp.PacketConn
+	pc     *ipv6.PacketConn
+	closed chan struct{}
+
+	// registry holds the IPs we're announcing and their MACs, shared
+	// with arpResponder and pcapAnnouncer.
+	registry *ipRegistry
+
+	reannounce *reannouncer
+
+	// conflicts exists only to satisfy the Announcer interface; NDP peer-
+	// conflict detection (the IPv6 equivalent of observePeer) is not yet
+	// implemented, so nothing is ever sent on it.
+	conflicts chan PeerConflict
+}
+
+func newNDPResponder(log logr.Logger, ifi *net.Interface) (*ndpResponder, error) {
+	conn, err := icmp.ListenPacket("ip6:ipv6-icmp", "::")
+	if err != nil {
+		return nil, fmt.Errorf("creating NDP responder for %q: %s", ifi.Name, err)
+	}
+
+	pc := conn.IPv6PacketConn()
+	if err := pc.SetControlMessage(ipv6.FlagDst|ipv6.FlagInterface, true); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("setting control message flags for %q: %s", ifi.Name, err)
+	}
+
+	var f ipv6.ICMPFilter
+	f.SetAll(true)
+	f.Accept(ipv6.ICMPType(icmpTypeNeighborSolicitation))
+	if err := pc.SetICMPFilter(&f); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("setting ICMPv6 filter for %q: %s", ifi.Name, err)
+	}
+
+	ret := &ndpResponder{
+		logger:    log.WithName("ndpResponder"),
+		intf:      ifi,
+		conn:      conn,
+		pc:        pc,
+		closed:    make(chan struct{}),
+		registry:  newIPRegistry(),
+		conflicts: make(chan PeerConflict, 16),
+	}
+	ret.reannounce = newReannouncer(ret.closed, ret.sendUnsolicitedNA, ret.registry.ips)
+	go ret.run()
+	return ret, nil
+}
+
+// Conflicts returns the channel on which PeerConflicts are delivered.
+// NDP peer-conflict detection isn't implemented yet, so this channel
+// never receives a value; it exists so ndpResponder satisfies the same
+// Announcer surface as arpResponder.
+func (n *ndpResponder) Conflicts() <-chan PeerConflict {
+	return n.conflicts
+}
+
+func (n *ndpResponder) Close() error {
+	close(n.closed)
+	return n.conn.Close()
+}
+
+// SetReannounceInterval configures a periodic re-send of unsolicited
+// Neighbor Advertisements for every announced IP. An interval of zero
+// disables periodic re-announcement.
+func (n *ndpResponder) SetReannounceInterval(d time.Duration) {
+	n.reannounce.SetInterval(d)
+}
+
+// sendUnsolicitedNA re-sends the unsolicited Neighbor Advertisement for
+// an already-announced ip, using whatever MAC is currently registered
+// for it. It is used both for the initial post-announce burst and for
+// periodic re-announcement.
+func (n *ndpResponder) sendUnsolicitedNA(ip net.IP) {
+	hwAddr := n.registry.lookup(ip.String())
+	if hwAddr == nil {
+		return
+	}
+
+	msg, err := generateNA(*hwAddr, ip, ip, false /* unsolicited */)
+	if err != nil {
+		n.logger.Error(err, "generating re-announce neighbor advertisement", "eip", ip)
+		return
+	}
+	if _, err := n.pc.WriteTo(msg, nil, &net.IPAddr{IP: net.IPv6linklocalallnodes, Zone: n.intf.Name}); err != nil {
+		n.logger.Error(err, "send re-announce neighbor advertisement", "eip", ip)
+	}
+}
+
+func (n *ndpResponder) DeleteIP(ip string) {
+	if mcast, err := solicitedNodeMulticast(net.ParseIP(ip)); err == nil {
+		if err := n.pc.LeaveGroup(n.intf, &net.IPAddr{IP: mcast}); err != nil {
+			n.logger.Error(err, "leaving solicited-node multicast group", "ip", ip)
+		}
+	}
+	n.registry.delete(ip)
+	forgetAnnounce(ip)
+	if parsed := net.ParseIP(ip); parsed != nil {
+		n.reannounce.forgetAnnounced(parsed)
+	}
+}
+
+// solicitedNodeMulticast returns the solicited-node multicast address
+// (ff02::1:ffXX:XXXX) that corresponds to the low 24 bits of ip.
+func solicitedNodeMulticast(ip net.IP) (net.IP, error) {
+	ip16 := ip.To16()
+	if ip16 == nil || ip.To4() != nil {
+		return nil, fmt.Errorf("%s is not an IPv6 address", ip)
+	}
+
+	mcast := net.ParseIP("ff02::1:ff00:0000")
+	copy(mcast[13:], ip16[13:])
+	return mcast, nil
+}
+
+// resolveNodeMAC resolves the link-layer address that should be used to
+// source announcements for nodeIP, mirroring resolveIP's role for ARP:
+// it first checks the kernel's IPv6 neighbor cache, then falls back to
+// actively soliciting, with retries, so a freshly booted node or an
+// aged-out cache entry doesn't leave it unresolved.
+func resolveNodeMAC(nodeIP net.IP, iface *net.Interface) (net.HardwareAddr, error) {
+	if neighs, err := netlink.NeighList(iface.Index, netlink.FAMILY_V6); err == nil {
+		for _, n := range neighs {
+			if n.IP.Equal(nodeIP) && len(n.HardwareAddr) > 0 {
+				return n.HardwareAddr, nil
+			}
+		}
+	}
+
+	var (
+		hwAddr net.HardwareAddr
+		err    error
+	)
+	for i := 0; i < 3; i++ {
+		hwAddr, err = solicitNeighborMAC(nodeIP, iface)
+		if err == nil {
+			return hwAddr, nil
+		}
+	}
+	return nil, fmt.Errorf("resolving neighbor %s on %q: %s", nodeIP, iface.Name, err)
+}
+
+// ndpSolicitTimeout bounds how long solicitNeighborMAC waits for a
+// Neighbor Advertisement reply to a single solicitation.
+const ndpSolicitTimeout = time.Second
+
+// solicitNeighborMAC sends a single Neighbor Solicitation for target and
+// waits for the corresponding Neighbor Advertisement, returning the
+// target link-layer address it carries.
+func solicitNeighborMAC(target net.IP, iface *net.Interface) (net.HardwareAddr, error) {
+	conn, err := icmp.ListenPacket("ip6:ipv6-icmp", "::")
+	if err != nil {
+		return nil, fmt.Errorf("opening neighbor solicitation socket on %q: %s", iface.Name, err)
+	}
+	defer conn.Close()
+
+	pc := conn.IPv6PacketConn()
+	var f ipv6.ICMPFilter
+	f.SetAll(true)
+	f.Accept(ipv6.ICMPType(icmpTypeNeighborAdvertisement))
+	if err := pc.SetICMPFilter(&f); err != nil {
+		return nil, fmt.Errorf("setting ICMPv6 filter on %q: %s", iface.Name, err)
+	}
+	if err := pc.SetMulticastInterface(iface); err != nil {
+		return nil, fmt.Errorf("setting multicast interface on %q: %s", iface.Name, err)
+	}
+
+	mcast, err := solicitedNodeMulticast(target)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := generateNS(iface.HardwareAddr, target)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := pc.WriteTo(req, nil, &net.IPAddr{IP: mcast, Zone: iface.Name}); err != nil {
+		return nil, fmt.Errorf("sending neighbor solicitation for %s: %s", target, err)
+	}
+
+	if err := conn.SetReadDeadline(time.Now().Add(ndpSolicitTimeout)); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, _, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			return nil, fmt.Errorf("waiting for neighbor advertisement for %s: %s", target, err)
+		}
+
+		msg, err := icmp.ParseMessage(58 /* ICMPv6 */, buf[:n])
+		if err != nil || msg.Type != ipv6.ICMPType(icmpTypeNeighborAdvertisement) {
+			continue
+		}
+		body, ok := msg.Body.(*icmp.RawBody)
+		if !ok || len(body.Data) < 20 || !net.IP(body.Data[4:20]).Equal(target) {
+			continue
+		}
+		if hwAddr := ndpLinkLayerOption(body.Data, ndpOptTargetLinkLayerAddr); hwAddr != nil {
+			return hwAddr, nil
+		}
+	}
+}
+
+// ndpLinkLayerOption scans the NDP options following a Neighbor
+// Solicitation/Advertisement's fixed 20-byte header for an option of the
+// given type, returning its link-layer address, or nil if not present.
+func ndpLinkLayerOption(body []byte, optType byte) net.HardwareAddr {
+	for i := 20; i+2 <= len(body); {
+		optLen := int(body[i+1]) * 8
+		if optLen == 0 || i+optLen > len(body) {
+			return nil
+		}
+		if body[i] == optType {
+			return net.HardwareAddr(body[i+2 : i+optLen])
+		}
+		i += optLen
+	}
+	return nil
+}
+
+// Gratuitous announces ip as reachable via nodeIP, sending an unsolicited
+// Neighbor Advertisement and registering ip in the responder's registry
+// so that subsequent Neighbor Solicitations are answered.
+func (n *ndpResponder) Gratuitous(ip, nodeIP net.IP) error {
+	if ip.To4() != nil {
+		return nil
+	}
+
+	var hwAddr net.HardwareAddr
+
+	routers, err := netlink.RouteGet(nodeIP)
+	if err != nil {
+		return err
+	}
+
+	iface, err := net.InterfaceByIndex(routers[0].LinkIndex)
+	if err != nil {
+		return err
+	}
+
+	if iface.Name != "lo" && routers[0].LinkIndex != n.intf.Index {
+		return nil
+	}
+
+	if iface.Name == "lo" {
+		hwAddr = n.intf.HardwareAddr
+	} else {
+		hwAddr, err = resolveNodeMAC(nodeIP, n.intf)
+		if err != nil {
+			return err
+		}
+	}
+
+	mcast, err := solicitedNodeMulticast(ip)
+	if err != nil {
+		return err
+	}
+	if err := n.pc.JoinGroup(n.intf, &net.IPAddr{IP: mcast}); err != nil {
+		return fmt.Errorf("joining solicited-node multicast group for %s: %s", ip, err)
+	}
+
+	n.registry.set(ip.String(), hwAddr)
+	recordAnnounce(ip)
+	n.reannounce.noteAnnounced(ip)
+
+	n.logger.Info("send unsolicited neighbor advertisement", "eip", ip, "nodeIP", nodeIP, "hwAddr", hwAddr)
+
+	msg, err := generateNA(hwAddr, ip, ip, false /* unsolicited */)
+	if err != nil {
+		return err
+	}
+	if _, err := n.pc.WriteTo(msg, nil, &net.IPAddr{IP: net.IPv6linklocalallnodes, Zone: n.intf.Name}); err != nil {
+		n.logger.Error(err, "send neighbor advertisement")
+		return err
+	}
+
+	return nil
+}
+
+// generateNA builds a raw Neighbor Advertisement ICMPv6 message for
+// target, sourced from srcHW. dst is not used: the message carries no
+// destination, and the caller picks where to send it. solicited controls the
+// Solicited flag; Override is always set since we are the authority for
+// announced VIPs, and Router is left unset as porter does not advertise
+// itself as a router.
+func generateNA(srcHW net.HardwareAddr, target, dst net.IP, solicited bool) ([]byte, error) {
+	flags := uint32(naFlagOverride)
+	if solicited {
+		flags |= naFlagSolicited
+	}
+
+	body := make([]byte, 4+16+2+len(srcHW))
+	putUint32(body[0:4], flags)
+	copy(body[4:20], target.To16())
+	body[20] = ndpOptTargetLinkLayerAddr
+	body[21] = byte((2 + len(srcHW)) / 8)
+	copy(body[22:], srcHW)
+
+	msg := icmp.Message{
+		Type: ipv6.ICMPType(icmpTypeNeighborAdvertisement),
+		Code: 0,
+		Body: &icmp.RawBody{Data: body},
+	}
+
+	return msg.Marshal(nil)
+}
+
+// generateNS builds a raw Neighbor Solicitation ICMPv6 message asking
+// who has target, sourced from srcHW so the Neighbor Advertisement reply
+// can be sent back to us directly instead of via multicast.
+func generateNS(srcHW net.HardwareAddr, target net.IP) ([]byte, error) {
+	body := make([]byte, 4+16+2+len(srcHW))
+	copy(body[4:20], target.To16())
+	body[20] = ndpOptSourceLinkLayerAddr
+	body[21] = byte((2 + len(srcHW)) / 8)
+	copy(body[22:], srcHW)
+
+	msg := icmp.Message{
+		Type: ipv6.ICMPType(icmpTypeNeighborSolicitation),
+		Code: 0,
+		Body: &icmp.RawBody{Data: body},
+	}
+
+	return msg.Marshal(nil)
+}
+
+func putUint32(b []byte, v uint32) {
+	b[0] = byte(v >> 24)
+	b[1] = byte(v >> 16)
+	b[2] = byte(v >> 8)
+	b[3] = byte(v)
+}
+
+func (n *ndpResponder) run() {
+	for n.processRequest() != dropReasonClosed {
+	}
+}
+
+func (n *ndpResponder) processRequest() dropReason {
+	buf := make([]byte, 1500)
+	nr, _, src, err := n.pc.ReadFrom(buf)
+	if err != nil {
+		select {
+		case <-n.closed:
+			return dropReasonClosed
+		default:
+		}
+		return dropReasonError
+	}
+
+	msg, err := icmp.ParseMessage(58 /* ICMPv6 */, buf[:nr])
+	if err != nil || msg.Type != ipv6.ICMPType(icmpTypeNeighborSolicitation) {
+		return dropReasonARPReply
+	}
+
+	raw, ok := msg.Body.(*icmp.RawBody)
+	if !ok || len(raw.Data) < 20 {
+		return dropReasonError
+	}
+	target := net.IP(raw.Data[4:20])
+
+	hwAddr := n.registry.lookup(target.String())
+	if hwAddr == nil {
+		return dropReasonAnnounceIP
+	}
+
+	n.logger.Info("got neighbor solicitation, sending advertisement", "interface", n.intf.Name, "ip", target, "senderIP", src)
+
+	resp, err := generateNA(*hwAddr, target, target, true /* solicited */)
+	if err != nil {
+		return dropReasonError
+	}
+	if _, err := n.pc.WriteTo(resp, nil, src); err != nil {
+		n.logger.Error(err, "send neighbor advertisement", "interface", n.intf.Name, "ip", target, "senderIP", src)
+	}
+	return dropReasonNone
+}
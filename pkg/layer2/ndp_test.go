@@ -0,0 +1,56 @@
+package layer2
+
+import (
+	"net"
+	"testing"
+)
+
+func TestSolicitedNodeMulticast(t *testing.T) {
+	tests := []struct {
+		ip      string
+		want    string
+		wantErr bool
+	}{
+		{ip: "2001:db8::1", want: "ff02::1:ff00:1"},
+		{ip: "2001:db8::abcd:1234", want: "ff02::1:ffcd:1234"},
+		{ip: "192.0.2.1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			got, err := solicitedNodeMulticast(net.ParseIP(tt.ip))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("solicitedNodeMulticast(%s) = %s, want error", tt.ip, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("solicitedNodeMulticast(%s) returned error: %s", tt.ip, err)
+			}
+			if want := net.ParseIP(tt.want); !got.Equal(want) {
+				t.Errorf("solicitedNodeMulticast(%s) = %s, want %s", tt.ip, got, want)
+			}
+		})
+	}
+}
+
+func TestNDPLinkLayerOption(t *testing.T) {
+	mac := mustParseMAC(t, "00:11:22:33:44:55")
+
+	msg, err := generateNS(mac, net.ParseIP("2001:db8::1"))
+	if err != nil {
+		t.Fatalf("generateNS: %s", err)
+	}
+
+	// Strip the 4-byte ICMPv6 header that Marshal prepends, leaving the
+	// NS body ndpLinkLayerOption expects.
+	body := msg[4:]
+	got := ndpLinkLayerOption(body, ndpOptSourceLinkLayerAddr)
+	if !bytesEqualHW(got, mac) {
+		t.Errorf("ndpLinkLayerOption(SourceLinkLayerAddr) = %s, want %s", got, mac)
+	}
+	if got := ndpLinkLayerOption(body, ndpOptTargetLinkLayerAddr); got != nil {
+		t.Errorf("ndpLinkLayerOption(TargetLinkLayerAddr) = %s, want nil", got)
+	}
+}
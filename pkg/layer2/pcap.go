@@ -0,0 +1,251 @@
+package layer2
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"github.com/mdlayher/arp"
+	"github.com/mdlayher/ethernet"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/time/rate"
+)
+
+// arpBPFFilter matches both ARP requests (arp[6:2] = 1) and ARP replies
+// (arp[6:2] = 2), so pcapAnnouncer can observe peer-conflict traffic the
+// same way arpResponder does.
+const arpBPFFilter = "arp[6:2] = 1 or arp[6:2] = 2"
+
+// pcapAnnouncer is an Announcer backend built on github.com/google/gopacket/pcap
+// instead of mdlayher/raw + mdlayher/arp. It exists for platforms/kernels
+// where AF_PACKET raw sockets are restricted, and for capturing on
+// bridged/VLAN sub-interfaces that raw sockets can't see cleanly. It
+// otherwise mirrors arpResponder feature-for-feature: peer-conflict
+// detection, reply rate limiting, metrics, and periodic re-announcement.
+type pcapAnnouncer struct {
+	logger logr.Logger
+
+	intf   *net.Interface
+	handle *pcap.Handle
+	closed chan struct{}
+
+	registry *ipRegistry
+	peers    *peerTracker
+
+	conflicts  chan PeerConflict
+	limiter    *replyLimiter
+	reannounce *reannouncer
+}
+
+func newPcapAnnouncer(log logr.Logger, ifi *net.Interface, replyRate rate.Limit, replyBurst int) (*pcapAnnouncer, error) {
+	handle, err := pcap.OpenLive(ifi.Name, 128, false, pcap.BlockForever)
+	if err != nil {
+		return nil, fmt.Errorf("opening pcap handle on %q: %s", ifi.Name, err)
+	}
+	if err := handle.SetBPFFilter(arpBPFFilter); err != nil {
+		handle.Close()
+		return nil, fmt.Errorf("setting BPF filter on %q: %s", ifi.Name, err)
+	}
+
+	ret := &pcapAnnouncer{
+		logger:    log.WithName("pcapAnnouncer"),
+		intf:      ifi,
+		handle:    handle,
+		closed:    make(chan struct{}),
+		registry:  newIPRegistry(),
+		peers:     newPeerTracker(),
+		conflicts: make(chan PeerConflict, 16),
+		limiter:   newReplyLimiter(replyRate, replyBurst),
+	}
+	ret.reannounce = newReannouncer(ret.closed, ret.sendGratuitousPacket, ret.registry.ips)
+	go ret.run()
+	return ret, nil
+}
+
+func (p *pcapAnnouncer) Close() error {
+	close(p.closed)
+	p.handle.Close()
+	return nil
+}
+
+func (p *pcapAnnouncer) Conflicts() <-chan PeerConflict {
+	return p.conflicts
+}
+
+// SetReannounceInterval configures a periodic re-send of the gratuitous
+// request+reply pair for every announced IP. An interval of zero
+// disables periodic re-announcement.
+func (p *pcapAnnouncer) SetReannounceInterval(d time.Duration) {
+	p.reannounce.SetInterval(d)
+}
+
+func (p *pcapAnnouncer) DeleteIP(ip string) {
+	p.registry.delete(ip)
+	p.peers.forget(ip)
+	forgetAnnounce(ip)
+	if parsed := net.ParseIP(ip); parsed != nil {
+		p.reannounce.forgetAnnounced(parsed)
+	}
+}
+
+// sendGratuitousPacket re-sends the gratuitous request+reply pair for an
+// already-announced ip, using whatever MAC is currently registered for
+// it. It is used both for the initial post-announce burst and for
+// periodic re-announcement.
+func (p *pcapAnnouncer) sendGratuitousPacket(ip net.IP) {
+	hwAddr := p.registry.lookup(ip.String())
+	if hwAddr == nil {
+		return
+	}
+
+	for _, op := range []arp.Operation{arp.OperationRequest, arp.OperationReply} {
+		fb, err := generateArp(p.intf.HardwareAddr, op, *hwAddr, ip, ethernet.Broadcast, ip)
+		if err != nil {
+			p.logger.Error(err, "generating re-announce arp packet", "eip", ip)
+			return
+		}
+		if err := p.handle.WritePacketData(fb); err != nil {
+			p.logger.Error(err, "send re-announce arp packet", "eip", ip)
+			return
+		}
+	}
+}
+
+func (p *pcapAnnouncer) Gratuitous(ip, nodeIP net.IP) error {
+	var (
+		hwAddr net.HardwareAddr
+		err    error
+	)
+
+	if ip.To4() == nil {
+		return nil
+	}
+
+	routers, err := netlink.RouteGet(nodeIP)
+	if err != nil {
+		return err
+	}
+
+	iface, err := net.InterfaceByIndex(routers[0].LinkIndex)
+	if err != nil {
+		return err
+	}
+
+	if iface.Name != "lo" && routers[0].LinkIndex != p.intf.Index {
+		return nil
+	}
+
+	if iface.Name == "lo" {
+		hwAddr = p.intf.HardwareAddr
+	} else {
+		hwAddr, err = resolveIP(nodeIP, p.intf)
+		if err != nil {
+			return err
+		}
+	}
+
+	p.registry.set(ip.String(), hwAddr)
+	recordAnnounce(ip)
+	p.reannounce.noteAnnounced(ip)
+
+	for _, op := range []arp.Operation{arp.OperationRequest, arp.OperationReply} {
+		p.logger.Info("send gratuitous arp packet", "eip", ip, "nodeIP", nodeIP, "hwAddr", hwAddr)
+
+		fb, err := generateArp(p.intf.HardwareAddr, op, hwAddr, ip, ethernet.Broadcast, ip)
+		if err != nil {
+			return err
+		}
+		if err := p.handle.WritePacketData(fb); err != nil {
+			p.logger.Error(err, "send gratuitous arp packet")
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *pcapAnnouncer) run() {
+	src := gopacket.NewPacketSource(p.handle, layers.LayerTypeEthernet)
+	pkts := src.Packets()
+	for {
+		select {
+		case <-p.closed:
+			return
+		case pkt, ok := <-pkts:
+			if !ok {
+				return
+			}
+			p.processPacket(pkt)
+		}
+	}
+}
+
+func (p *pcapAnnouncer) processPacket(pkt gopacket.Packet) {
+	layer := pkt.Layer(layers.LayerTypeARP)
+	if layer == nil {
+		return
+	}
+	req := layer.(*layers.ARP)
+
+	senderIP := net.IP(req.SourceProtAddress)
+	targetIP := net.IP(req.DstProtAddress)
+	senderMAC := net.HardwareAddr(req.SourceHwAddress)
+
+	if req.Operation != layers.ARPRequest {
+		p.observePeer(senderIP, senderMAC)
+		recordDrop(dropReasonARPReply)
+		return
+	}
+
+	arpRequestsReceived.Inc()
+
+	if senderIP.Equal(targetIP) {
+		p.observePeer(senderIP, senderMAC)
+	}
+
+	hwAddr := p.registry.lookup(targetIP.String())
+	if hwAddr == nil {
+		recordDrop(dropReasonAnnounceIP)
+		return
+	}
+
+	if !p.limiter.Allow(targetIP, senderMAC) {
+		arpRepliesThrottled.Inc()
+		recordDrop(dropReasonThrottled)
+		return
+	}
+
+	p.logger.Info("got ARP request, sending response", "interface", p.intf.Name, "ip", targetIP, "senderIP", senderIP, "senderMAC", senderMAC, "responseMAC", hwAddr)
+	fb, err := generateArp(p.intf.HardwareAddr, arp.OperationReply, *hwAddr, targetIP, senderMAC, senderIP)
+	if err != nil {
+		p.logger.Error(err, "generating ARP reply")
+		recordDrop(dropReasonError)
+		return
+	}
+	if err := p.handle.WritePacketData(fb); err != nil {
+		p.logger.Error(err, "send ARP reply", "interface", p.intf.Name, "ip", targetIP)
+		recordDrop(dropReasonError)
+		return
+	}
+	arpRepliesSent.Inc()
+}
+
+func (p *pcapAnnouncer) observePeer(ip net.IP, peerMAC net.HardwareAddr) {
+	ourMAC := p.registry.lookup(ip.String())
+
+	conflict := p.peers.observe(ip, peerMAC, ourMAC)
+	if conflict == nil {
+		return
+	}
+
+	p.logger.Info("peer claims announced IP with a different MAC", "ip", ip, "ourMAC", conflict.OurMAC, "peerMAC", conflict.PeerMAC)
+	select {
+	case p.conflicts <- *conflict:
+	default:
+		p.logger.Info("conflicts channel full, dropping peer conflict event", "ip", ip)
+	}
+}
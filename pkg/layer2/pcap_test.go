@@ -0,0 +1,10 @@
+package layer2
+
+import "testing"
+
+func TestNewAnnouncerUnknownBackend(t *testing.T) {
+	_, err := NewAnnouncer(Config{Backend: Backend("bogus")})
+	if err == nil {
+		t.Fatalf("NewAnnouncer with an unknown backend succeeded, want error")
+	}
+}
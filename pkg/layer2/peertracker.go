@@ -0,0 +1,81 @@
+package layer2
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// peerTrackerTTL is how long a peer's last-observed MAC is kept
+	// before it's eligible for eviction. Without this, a scanner
+	// sweeping the subnet (or just ordinary broadcast-domain chatter)
+	// would grow the tracker without bound, the same exposure
+	// replyLimiterTTL exists to close off on the replying side.
+	peerTrackerTTL = 5 * time.Minute
+	// peerTrackerSweepEvery sweeps expired entries every this many
+	// calls to observe, so the sweep cost is amortized across traffic
+	// instead of requiring its own goroutine.
+	peerTrackerSweepEvery = 1024
+)
+
+// peerTracker is a rolling, TTL-bounded record of the last MAC address
+// observed claiming each IP on the wire, shared by arpResponder and
+// pcapAnnouncer so the two backends can't drift out of parity on this
+// bookkeeping.
+type peerTracker struct {
+	mu    sync.Mutex
+	peers map[string]peerEntry
+	calls uint64
+}
+
+type peerEntry struct {
+	mac      net.HardwareAddr
+	lastSeen time.Time
+}
+
+func newPeerTracker() *peerTracker {
+	return &peerTracker{peers: make(map[string]peerEntry)}
+}
+
+// observe records that peerMAC claims ip on the wire, and reports a
+// PeerConflict if ourMAC is non-nil and differs from peerMAC.
+func (t *peerTracker) observe(ip net.IP, peerMAC net.HardwareAddr, ourMAC *net.HardwareAddr) *PeerConflict {
+	if ip == nil || len(peerMAC) == 0 {
+		return nil
+	}
+
+	key := ip.String()
+	now := time.Now()
+
+	t.mu.Lock()
+	t.calls++
+	if t.calls%peerTrackerSweepEvery == 0 {
+		t.sweepLocked(now)
+	}
+	t.peers[key] = peerEntry{mac: peerMAC, lastSeen: now}
+	t.mu.Unlock()
+
+	if ourMAC == nil || bytesEqualHW(*ourMAC, peerMAC) {
+		return nil
+	}
+	return &PeerConflict{IP: ip, OurMAC: *ourMAC, PeerMAC: peerMAC}
+}
+
+// sweepLocked removes entries that haven't been refreshed in
+// peerTrackerTTL. t.mu must be held.
+func (t *peerTracker) sweepLocked(now time.Time) {
+	for key, e := range t.peers {
+		if now.Sub(e.lastSeen) > peerTrackerTTL {
+			delete(t.peers, key)
+		}
+	}
+}
+
+// forget removes any tracked entry for ip, e.g. when the IP stops being
+// announced and we no longer care who else claims it.
+func (t *peerTracker) forget(ip string) {
+	t.mu.Lock()
+	delete(t.peers, ip)
+	t.mu.Unlock()
+}
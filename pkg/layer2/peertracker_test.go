@@ -0,0 +1,78 @@
+package layer2
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPeerTrackerObserveReportsConflict(t *testing.T) {
+	ip := net.ParseIP("192.0.2.1")
+	ourMAC := mustParseMAC(t, "00:11:22:33:44:55")
+	peerMAC := mustParseMAC(t, "00:11:22:33:44:66")
+
+	tr := newPeerTracker()
+
+	if got := tr.observe(ip, peerMAC, nil); got != nil {
+		t.Fatalf("observe with no registered MAC = %v, want nil", got)
+	}
+	if got := tr.observe(ip, ourMAC, &ourMAC); got != nil {
+		t.Fatalf("observe with matching MAC = %v, want nil", got)
+	}
+
+	got := tr.observe(ip, peerMAC, &ourMAC)
+	if got == nil {
+		t.Fatalf("observe with differing MAC = nil, want a conflict")
+	}
+	if !got.IP.Equal(ip) || !bytesEqualHW(got.OurMAC, ourMAC) || !bytesEqualHW(got.PeerMAC, peerMAC) {
+		t.Errorf("observe conflict = %+v, want IP=%s OurMAC=%s PeerMAC=%s", got, ip, ourMAC, peerMAC)
+	}
+}
+
+func TestPeerTrackerForget(t *testing.T) {
+	ip := net.ParseIP("192.0.2.1")
+	mac := mustParseMAC(t, "00:11:22:33:44:55")
+
+	tr := newPeerTracker()
+	tr.observe(ip, mac, nil)
+
+	tr.mu.Lock()
+	_, ok := tr.peers[ip.String()]
+	tr.mu.Unlock()
+	if !ok {
+		t.Fatalf("expected peer to be tracked after observe")
+	}
+
+	tr.forget(ip.String())
+
+	tr.mu.Lock()
+	_, ok = tr.peers[ip.String()]
+	tr.mu.Unlock()
+	if ok {
+		t.Errorf("expected forget to remove the tracked peer")
+	}
+}
+
+func TestPeerTrackerSweepsStaleEntries(t *testing.T) {
+	tr := newPeerTracker()
+
+	ip := net.ParseIP("192.0.2.1")
+	mac := mustParseMAC(t, "00:11:22:33:44:55")
+	tr.observe(ip, mac, nil)
+
+	tr.mu.Lock()
+	tr.peers[ip.String()] = peerEntry{mac: mac, lastSeen: time.Now().Add(-2 * peerTrackerTTL)}
+	tr.calls = peerTrackerSweepEvery - 1
+	tr.mu.Unlock()
+
+	// This call crosses the sweep threshold. It uses a second, unrelated
+	// key so that it can't refresh the stale entry it should sweep.
+	otherIP := net.ParseIP("192.0.2.2")
+	tr.observe(otherIP, mac, nil)
+
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if _, ok := tr.peers[ip.String()]; ok {
+		t.Errorf("stale peer entry was not swept")
+	}
+}
@@ -0,0 +1,127 @@
+package layer2
+
+import (
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// reannounceBurstCount is how many extra announcements are sent in
+	// quick succession the first time an IP is announced, to survive
+	// packet loss on the initial gratuitous announce.
+	reannounceBurstCount = 3
+	reannounceBurstDelay = 200 * time.Millisecond
+
+	// reannounceJitterFraction bounds how much a periodic re-announce is
+	// shifted earlier or later, so that many responders re-announcing on
+	// the same interval don't all hit the wire at once.
+	reannounceJitterFraction = 0.2
+)
+
+// reannouncer periodically re-sends gratuitous announcements for a set
+// of IPs, and bursts a few extra ones right after an IP is first
+// announced. arpResponder, ndpResponder and pcapAnnouncer each hold one,
+// so ARP and NDP share one scheduling implementation.
+type reannouncer struct {
+	mu       sync.Mutex
+	interval time.Duration
+	seen     map[string]bool
+
+	updated chan struct{}
+	closed  <-chan struct{}
+
+	// announce re-sends the gratuitous packet(s) for ip, using whatever
+	// MAC is currently registered for it. Supplied by the embedding
+	// responder, since the wire format differs between ARP and NDP.
+	announce func(ip net.IP)
+	// ips returns the current set of announced IPs.
+	ips func() []net.IP
+}
+
+func newReannouncer(closed <-chan struct{}, announce func(net.IP), ips func() []net.IP) *reannouncer {
+	r := &reannouncer{
+		seen:     make(map[string]bool),
+		updated:  make(chan struct{}, 1),
+		closed:   closed,
+		announce: announce,
+		ips:      ips,
+	}
+	go r.loop()
+	return r
+}
+
+// SetInterval sets the period between periodic re-announcements. Zero
+// disables periodic re-announcement (the initial burst still happens).
+func (r *reannouncer) SetInterval(d time.Duration) {
+	r.mu.Lock()
+	r.interval = d
+	r.mu.Unlock()
+
+	select {
+	case r.updated <- struct{}{}:
+	default:
+	}
+}
+
+// noteAnnounced triggers the first-announce burst the first time ip is
+// seen, and is a no-op on every call after that until forgetAnnounced(ip).
+func (r *reannouncer) noteAnnounced(ip net.IP) {
+	key := ip.String()
+
+	r.mu.Lock()
+	if r.seen[key] {
+		r.mu.Unlock()
+		return
+	}
+	r.seen[key] = true
+	r.mu.Unlock()
+
+	go func() {
+		for i := 0; i < reannounceBurstCount; i++ {
+			select {
+			case <-r.closed:
+				return
+			case <-time.After(reannounceBurstDelay):
+				r.announce(ip)
+			}
+		}
+	}()
+}
+
+func (r *reannouncer) forgetAnnounced(ip net.IP) {
+	r.mu.Lock()
+	delete(r.seen, ip.String())
+	r.mu.Unlock()
+}
+
+func (r *reannouncer) loop() {
+	for {
+		r.mu.Lock()
+		interval := r.interval
+		r.mu.Unlock()
+
+		var wait <-chan time.Time
+		if interval > 0 {
+			wait = time.After(jitter(interval, reannounceJitterFraction))
+		}
+
+		select {
+		case <-r.closed:
+			return
+		case <-r.updated:
+			continue
+		case <-wait:
+			for _, ip := range r.ips() {
+				r.announce(ip)
+			}
+		}
+	}
+}
+
+// jitter returns d shifted by a random amount within +/- frac*d.
+func jitter(d time.Duration, frac float64) time.Duration {
+	delta := (rand.Float64()*2 - 1) * frac * float64(d)
+	return d + time.Duration(delta)
+}
@@ -0,0 +1,83 @@
+package layer2
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestJitterWithinBounds(t *testing.T) {
+	const base = 100 * time.Millisecond
+	for i := 0; i < 1000; i++ {
+		got := jitter(base, reannounceJitterFraction)
+		lo := base - time.Duration(reannounceJitterFraction*float64(base))
+		hi := base + time.Duration(reannounceJitterFraction*float64(base))
+		if got < lo || got > hi {
+			t.Fatalf("jitter(%s, %v) = %s, want within [%s, %s]", base, reannounceJitterFraction, got, lo, hi)
+		}
+	}
+}
+
+func TestReannouncerBurstsOnFirstAnnounce(t *testing.T) {
+	closed := make(chan struct{})
+	defer close(closed)
+
+	var mu sync.Mutex
+	var calls int
+	ip := net.ParseIP("192.0.2.1")
+
+	r := newReannouncer(closed, func(got net.IP) {
+		if !got.Equal(ip) {
+			t.Errorf("announce called with %s, want %s", got, ip)
+		}
+		mu.Lock()
+		calls++
+		mu.Unlock()
+	}, func() []net.IP { return nil })
+
+	r.noteAnnounced(ip)
+	// A second call for the same IP must not trigger another burst.
+	r.noteAnnounced(ip)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		got := calls
+		mu.Unlock()
+		if got >= reannounceBurstCount {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != reannounceBurstCount {
+		t.Errorf("got %d burst announcements, want exactly %d", calls, reannounceBurstCount)
+	}
+}
+
+func TestReannouncerForgetAnnouncedAllowsReburst(t *testing.T) {
+	closed := make(chan struct{})
+	defer close(closed)
+
+	ip := net.ParseIP("192.0.2.1")
+	r := newReannouncer(closed, func(net.IP) {}, func() []net.IP { return nil })
+
+	r.noteAnnounced(ip)
+	r.mu.Lock()
+	seen := r.seen[ip.String()]
+	r.mu.Unlock()
+	if !seen {
+		t.Fatalf("expected ip to be marked seen after noteAnnounced")
+	}
+
+	r.forgetAnnounced(ip)
+	r.mu.Lock()
+	seen = r.seen[ip.String()]
+	r.mu.Unlock()
+	if seen {
+		t.Fatalf("expected forgetAnnounced to clear seen state")
+	}
+}
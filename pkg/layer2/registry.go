@@ -0,0 +1,53 @@
+package layer2
+
+import (
+	"net"
+	"sync"
+)
+
+// ipRegistry tracks the IPs an Announcer backend currently has
+// registered for replies. It's shared by arpResponder, ndpResponder and
+// pcapAnnouncer so the three backends can't drift out of parity on this
+// bookkeeping.
+type ipRegistry struct {
+	mu     sync.Mutex
+	ip2mac map[string]*net.HardwareAddr
+}
+
+func newIPRegistry() *ipRegistry {
+	return &ipRegistry{ip2mac: make(map[string]*net.HardwareAddr)}
+}
+
+// set registers ip as reachable via hwAddr.
+func (r *ipRegistry) set(ip string, hwAddr net.HardwareAddr) {
+	r.mu.Lock()
+	r.ip2mac[ip] = &hwAddr
+	r.mu.Unlock()
+}
+
+// lookup returns the MAC registered for ip, or nil if ip isn't
+// registered.
+func (r *ipRegistry) lookup(ip string) *net.HardwareAddr {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ip2mac[ip]
+}
+
+// delete forgets ip.
+func (r *ipRegistry) delete(ip string) {
+	r.mu.Lock()
+	delete(r.ip2mac, ip)
+	r.mu.Unlock()
+}
+
+// ips returns the IPs currently registered.
+func (r *ipRegistry) ips() []net.IP {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ips := make([]net.IP, 0, len(r.ip2mac))
+	for s := range r.ip2mac {
+		ips = append(ips, net.ParseIP(s))
+	}
+	return ips
+}
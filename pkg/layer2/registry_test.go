@@ -0,0 +1,55 @@
+package layer2
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIPRegistrySetLookupDelete(t *testing.T) {
+	ip := net.ParseIP("192.0.2.1")
+	mac := mustParseMAC(t, "00:11:22:33:44:55")
+
+	r := newIPRegistry()
+
+	if got := r.lookup(ip.String()); got != nil {
+		t.Fatalf("lookup before set = %v, want nil", got)
+	}
+
+	r.set(ip.String(), mac)
+	got := r.lookup(ip.String())
+	if got == nil || !bytesEqualHW(*got, mac) {
+		t.Fatalf("lookup after set = %v, want %s", got, mac)
+	}
+
+	r.delete(ip.String())
+	if got := r.lookup(ip.String()); got != nil {
+		t.Errorf("lookup after delete = %v, want nil", got)
+	}
+}
+
+func TestIPRegistryIPs(t *testing.T) {
+	r := newIPRegistry()
+	mac := mustParseMAC(t, "00:11:22:33:44:55")
+
+	want := []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2")}
+	for _, ip := range want {
+		r.set(ip.String(), mac)
+	}
+
+	got := r.ips()
+	if len(got) != len(want) {
+		t.Fatalf("ips() = %v, want %v", got, want)
+	}
+	for _, w := range want {
+		found := false
+		for _, g := range got {
+			if g.Equal(w) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("ips() missing %s", w)
+		}
+	}
+}